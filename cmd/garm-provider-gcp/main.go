@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cloudbase/garm-provider-common/execution"
+	"github.com/cloudbase/garm-provider-common/params"
+
+	"github.com/cloudbase/garm-provider-gcp/config"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+	"github.com/cloudbase/garm-provider-gcp/provider"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "dry-run" {
+		if err := runDryRun(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	ctx := context.Background()
+
+	env, err := execution.GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	prov, err := provider.NewGcpProvider(env.ProviderConfigFile, env.ControllerID)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	result, err := execution.Run(ctx, prov, env)
+	if err != nil {
+		return fmt.Errorf("failed to run provider: %w", err)
+	}
+
+	if _, err := fmt.Fprint(os.Stdout, result); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
+
+// runDryRun renders the user-data that would be sent to an instance for a
+// given BootstrapInstance JSON document, without creating anything. This
+// lets operators iterate on user-data templates without launching VMs.
+func runDryRun(args []string) error {
+	fs := flag.NewFlagSet("dry-run", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to the provider config file")
+	bootstrapParamsFile := fs.String("bootstrap-params", "", "path to a BootstrapInstance JSON file")
+	controllerID := fs.String("controller-id", "dry-run", "controller id to use when building the runner spec")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if *configFile == "" {
+		return fmt.Errorf("--config is required")
+	}
+	if *bootstrapParamsFile == "" {
+		return fmt.Errorf("--bootstrap-params is required")
+	}
+
+	cfg, err := config.NewConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	raw, err := os.ReadFile(*bootstrapParamsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read bootstrap params: %w", err)
+	}
+
+	var bootstrapParams params.BootstrapInstance
+	if err := json.Unmarshal(raw, &bootstrapParams); err != nil {
+		return fmt.Errorf("failed to unmarshal bootstrap params: %w", err)
+	}
+
+	runnerSpec, err := spec.GetRunnerSpecFromBootstrapParams(cfg, bootstrapParams, *controllerID)
+	if err != nil {
+		return fmt.Errorf("failed to build runner spec: %w", err)
+	}
+
+	userData, err := runnerSpec.ComposeUserData()
+	if err != nil {
+		return fmt.Errorf("failed to render user data: %w", err)
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, userData)
+	return err
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// NewConfig reads the garm-provider-gcp configuration file and returns a
+// validated Config.
+func NewConfig(cfgFile string) (*Config, error) {
+	var config Config
+	if _, err := toml.DecodeFile(cfgFile, &config); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating config: %w", err)
+	}
+	return &config, nil
+}
+
+// Config is the provider configuration, as loaded from the toml config file
+// referenced by the GARM_PROVIDER_CONFIG_FILE environment variable.
+type Config struct {
+	// CredentialsFile is the path on disk to the GCP service account
+	// credentials JSON file used to authenticate to the GCP APIs.
+	CredentialsFile string `toml:"credentials_file"`
+	// ProjectID is the GCP project in which instances will be created.
+	ProjectID string `toml:"project_id"`
+	// Zone is the default GCP zone instances are created in, unless
+	// overridden by extra_specs.
+	Zone string `toml:"zone"`
+	// NetworkID is the default network attached to created instances.
+	NetworkID string `toml:"network_id"`
+	// SubnetworkID is the default subnetwork attached to created instances.
+	SubnetworkID string `toml:"subnetwork_id"`
+	// UserDataTemplateDir, when set, is checked for a "<name>.tmpl" file
+	// before falling back to the provider's built-in user-data templates.
+	// This lets operators customize bootstrapping without forking the
+	// provider. See internal/spec.RunnerSpec.ComposeUserData.
+	UserDataTemplateDir string `toml:"user_data_template_dir"`
+	// UserDataBucket, when set, makes the provider upload the rendered
+	// user-data to this GCS bucket instead of embedding it inline in
+	// instance metadata, and point the instance at it via
+	// startup-script-url/windows-startup-script-url. This is required once
+	// the rendered user-data would exceed GCE's 256 KiB metadata value
+	// limit. Configure a short lifecycle rule on this bucket (e.g. delete
+	// objects older than a day) so leaked scripts from instances that were
+	// never cleanly deleted don't accumulate indefinitely.
+	UserDataBucket string `toml:"user_data_bucket"`
+}
+
+func (c *Config) Validate() error {
+	if c.CredentialsFile == "" {
+		return fmt.Errorf("missing credentials_file")
+	}
+	if _, err := os.Stat(c.CredentialsFile); err != nil {
+		return fmt.Errorf("failed to access credentials_file: %w", err)
+	}
+	if c.ProjectID == "" {
+		return fmt.Errorf("missing project_id")
+	}
+	if c.Zone == "" {
+		return fmt.Errorf("missing zone")
+	}
+	if c.NetworkID == "" {
+		return fmt.Errorf("missing network_id")
+	}
+	if c.SubnetworkID == "" {
+		return fmt.Errorf("missing subnetwork_id")
+	}
+	if c.UserDataTemplateDir != "" {
+		info, err := os.Stat(c.UserDataTemplateDir)
+		if err != nil {
+			return fmt.Errorf("failed to access user_data_template_dir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("user_data_template_dir %q is not a directory", c.UserDataTemplateDir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package client wraps the GCP compute API clients used by the provider.
+package client
+
+import (
+	"context"
+	"fmt"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/cloudbase/garm-provider-gcp/config"
+)
+
+// GcpCli wraps the GCP compute clients needed to manage runner instances.
+type GcpCli struct {
+	cfg *config.Config
+
+	projectID string
+
+	instances *compute.InstancesClient
+	storage   *storage.Client
+}
+
+// NewGcpCli returns a GcpCli authenticated against the project configured
+// in cfg, using the service account credentials referenced by
+// cfg.CredentialsFile.
+func NewGcpCli(ctx context.Context, cfg *config.Config) (*GcpCli, error) {
+	opts := option.WithCredentialsFile(cfg.CredentialsFile)
+
+	instancesClient, err := compute.NewInstancesRESTClient(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create instances client: %w", err)
+	}
+
+	storageClient, err := storage.NewClient(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	return &GcpCli{
+		cfg:       cfg,
+		projectID: cfg.ProjectID,
+		instances: instancesClient,
+		storage:   storageClient,
+	}, nil
+}
+
+func (g *GcpCli) Close() error {
+	if err := g.storage.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return g.instances.Close()
+}
+
+// Instances returns the underlying GCE instances client, for callers that
+// need to issue requests this wrapper does not expose directly.
+func (g *GcpCli) Instances() *compute.InstancesClient {
+	return g.instances
+}
+
+// Storage returns the underlying GCS client, used to offload large
+// user-data payloads that would otherwise exceed the instance metadata
+// size limit.
+func (g *GcpCli) Storage() *storage.Client {
+	return g.storage
+}
+
+// ProjectID returns the GCP project instances are managed in.
+func (g *GcpCli) ProjectID() string {
+	return g.projectID
+}
+
+// Zone returns the default zone configured for this provider.
+func (g *GcpCli) Zone() string {
+	return g.cfg.Zone
+}
+
+// CredentialsFile returns the path to the service account credentials file
+// the provider authenticates with, which signed GCS URLs are minted with.
+func (g *GcpCli) CredentialsFile() string {
+	return g.cfg.CredentialsFile
+}
+
+// UserDataBucket returns the GCS bucket rendered user-data is uploaded to,
+// or an empty string when user-data is embedded inline in instance
+// metadata instead.
+func (g *GcpCli) UserDataBucket() string {
+	return g.cfg.UserDataBucket
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ignitionVersion       string = "3.4.0"
+	ignitionRunnerUser    string = "runner"
+	ignitionInstallPath   string = "/opt/garm/install_runner.sh"
+	ignitionInstallUnit   string = "garm-runner-install.service"
+	ignitionSudoersPath   string = "/etc/sudoers.d/garm"
+	ignitionFileModeExec  int    = 0o755
+	ignitionFileModeRegul int    = 0o440
+)
+
+// ignitionConfig is a minimal, typed representation of the subset of the
+// Ignition v3 config spec (https://coreos.github.io/ignition/configuration-v3_4/)
+// that we need in order to bootstrap a runner on Flatcar/Fedora CoreOS.
+type ignitionConfig struct {
+	Ignition ignitionMeta    `json:"ignition"`
+	Passwd   ignitionPasswd  `json:"passwd,omitempty"`
+	Storage  ignitionStorage `json:"storage,omitempty"`
+	Systemd  ignitionSystemd `json:"systemd,omitempty"`
+}
+
+type ignitionMeta struct {
+	Version string `json:"version"`
+}
+
+type ignitionPasswd struct {
+	Users []ignitionUser `json:"users,omitempty"`
+}
+
+type ignitionUser struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+type ignitionStorage struct {
+	Files []ignitionFile `json:"files,omitempty"`
+}
+
+type ignitionFile struct {
+	Path     string               `json:"path"`
+	Mode     int                  `json:"mode,omitempty"`
+	Contents ignitionFileContents `json:"contents"`
+}
+
+type ignitionFileContents struct {
+	Source string `json:"source"`
+}
+
+type ignitionSystemd struct {
+	Units []ignitionUnit `json:"units,omitempty"`
+}
+
+type ignitionUnit struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled,omitempty"`
+	Contents string `json:"contents,omitempty"`
+}
+
+// dataURLBase64 builds a RFC 2397 data URL with the base64 encoded payload,
+// as expected by the Ignition "contents.source" field.
+func dataURLBase64(contents []byte) string {
+	return "data:;base64," + base64.StdEncoding.EncodeToString(contents)
+}
+
+// composeIgnitionUserData wraps the runner install script in an Ignition v3
+// config that writes the script to disk, creates the runner user and
+// sudoers entry, and runs the script once on first boot via a oneshot
+// systemd unit. This is the bootstrap path used for immutable Linux images
+// such as Flatcar or Fedora CoreOS, which consume Ignition instead of a
+// plain shell script.
+func composeIgnitionUserData(installScript []byte) (string, error) {
+	unitContents := fmt.Sprintf(`[Unit]
+Description=Install the GARM runner
+After=network-online.target
+Wants=network-online.target
+ConditionFirstBoot=true
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+
+[Install]
+WantedBy=multi-user.target
+`, ignitionInstallPath)
+
+	cfg := ignitionConfig{
+		Ignition: ignitionMeta{
+			Version: ignitionVersion,
+		},
+		Passwd: ignitionPasswd{
+			Users: []ignitionUser{
+				{
+					Name:   ignitionRunnerUser,
+					Groups: []string{"sudo", "wheel"},
+				},
+			},
+		},
+		Storage: ignitionStorage{
+			Files: []ignitionFile{
+				{
+					Path: ignitionInstallPath,
+					Mode: ignitionFileModeExec,
+					Contents: ignitionFileContents{
+						Source: dataURLBase64(installScript),
+					},
+				},
+				{
+					Path: ignitionSudoersPath,
+					Mode: ignitionFileModeRegul,
+					Contents: ignitionFileContents{
+						Source: dataURLBase64([]byte(ignitionRunnerUser + "  ALL=(ALL) NOPASSWD:ALL\n")),
+					},
+				},
+			},
+		},
+		Systemd: ignitionSystemd{
+			Units: []ignitionUnit{
+				{
+					Name:     ignitionInstallUnit,
+					Enabled:  true,
+					Contents: unitContents,
+				},
+			},
+		},
+	}
+
+	asJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ignition config: %w", err)
+	}
+
+	return string(asJSON), nil
+}
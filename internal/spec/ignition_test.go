@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ignitionTestSchema only asserts the shape of the document that
+// composeIgnitionUserData is expected to produce; it is not a full
+// implementation of the upstream Ignition v3 config spec.
+const ignitionTestSchema = `
+	{
+		"type": "object",
+		"required": ["ignition", "passwd", "storage", "systemd"],
+		"properties": {
+			"ignition": {
+				"type": "object",
+				"required": ["version"],
+				"properties": {
+					"version": {"type": "string"}
+				}
+			},
+			"passwd": {
+				"type": "object",
+				"required": ["users"],
+				"properties": {
+					"users": {
+						"type": "array",
+						"minItems": 1,
+						"items": {
+							"type": "object",
+							"required": ["name", "groups"],
+							"properties": {
+								"name": {"type": "string"},
+								"groups": {"type": "array", "items": {"type": "string"}}
+							}
+						}
+					}
+				}
+			},
+			"storage": {
+				"type": "object",
+				"required": ["files"],
+				"properties": {
+					"files": {
+						"type": "array",
+						"minItems": 2,
+						"items": {
+							"type": "object",
+							"required": ["path", "contents"],
+							"properties": {
+								"path": {"type": "string"},
+								"mode": {"type": "integer"},
+								"contents": {
+									"type": "object",
+									"required": ["source"],
+									"properties": {
+										"source": {"type": "string"}
+									}
+								}
+							}
+						}
+					}
+				}
+			},
+			"systemd": {
+				"type": "object",
+				"required": ["units"],
+				"properties": {
+					"units": {
+						"type": "array",
+						"minItems": 1,
+						"items": {
+							"type": "object",
+							"required": ["name"],
+							"properties": {
+								"name": {"type": "string"},
+								"enabled": {"type": "boolean"},
+								"contents": {"type": "string"}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+`
+
+func TestComposeIgnitionUserData(t *testing.T) {
+	doc, err := composeIgnitionUserData([]byte("#!/bin/bash\necho hello\n"))
+	if err != nil {
+		t.Fatalf("composeIgnitionUserData returned an error: %s", err)
+	}
+
+	schemaLoader := gojsonschema.NewStringLoader(ignitionTestSchema)
+	docLoader := gojsonschema.NewStringLoader(doc)
+
+	result, err := gojsonschema.Validate(schemaLoader, docLoader)
+	if err != nil {
+		t.Fatalf("failed to validate ignition document: %s", err)
+	}
+	if !result.Valid() {
+		t.Fatalf("ignition document does not match expected schema: %s", result.Errors())
+	}
+}
+
+func TestExtraSpecsIgnitionUserDataFormatIsValidAndMerged(t *testing.T) {
+	spec := RunnerSpec{
+		UserDataFormat: userDataFormatIgnition,
+	}
+
+	e := &extraSpecs{UserDataFormat: userDataFormatIgnition}
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected 'ignition' user_data_format to be valid, got: %s", err)
+	}
+
+	spec.MergeExtraSpecs(e)
+	if spec.UserDataFormat != userDataFormatIgnition {
+		t.Fatalf("expected merged UserDataFormat to be %q, got %q", userDataFormatIgnition, spec.UserDataFormat)
+	}
+}
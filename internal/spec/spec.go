@@ -32,15 +32,17 @@ import (
 )
 
 const (
-	defaultDiskSizeGB     int64  = 127
-	defaultNicType        string = "VIRTIO_NET"
-	garmPoolID            string = "garmpoolid"
-	garmControllerID      string = "garmcontrollerid"
-	osType                string = "ostype"
-	customLabelKeyRegex   string = "^\\p{Ll}[\\p{Ll}0-9_-]{0,62}$"
-	customLabelValueRegex string = "^[\\p{Ll}0-9_-]{0,63}$"
-	networkTagRegex       string = "^[a-z][a-z0-9-]{0,61}[a-z0-9]$"
-	jsonSchema            string = `
+	defaultDiskSizeGB      int64  = 127
+	defaultNicType         string = "VIRTIO_NET"
+	garmPoolID             string = "garmpoolid"
+	garmControllerID       string = "garmcontrollerid"
+	osType                 string = "ostype"
+	customLabelKeyRegex    string = "^\\p{Ll}[\\p{Ll}0-9_-]{0,62}$"
+	customLabelValueRegex  string = "^[\\p{Ll}0-9_-]{0,63}$"
+	networkTagRegex        string = "^[a-z][a-z0-9-]{0,61}[a-z0-9]$"
+	userDataTemplateRegex  string = "^[a-zA-Z0-9_-]+$"
+	userDataFormatIgnition string = "ignition"
+	jsonSchema             string = `
 		{
 			"$schema": "http://cloudbase.it/garm-provider-gcp/schemas/extra_specs#",
 			"type": "object",
@@ -79,6 +81,91 @@ const (
 				"source_snapshot": {
 					"type": "string",
 					"description": "The source snapshot to create this disk."
+				},
+				"user_data_format": {
+					"type": "string",
+					"enum": ["ignition"],
+					"description": "If set to 'ignition', the instance is bootstrapped with an Ignition v3 config instead of a shell script. Use this for image families that consume Ignition, such as Flatcar or Fedora CoreOS."
+				},
+				"user_data_template": {
+					"type": "string",
+					"description": "The name of the user-data template to render. Built-in templates are 'debian', 'rhel', 'suse' and 'windows'. If config.UserDataTemplateDir is set, a '<name>.tmpl' file in that directory takes precedence over the built-in template of the same name. Defaults to 'debian' on Linux and 'windows' on Windows."
+				},
+				"user_data_object_prefix": {
+					"type": "string",
+					"description": "Only used when config.UserDataBucket is set. Prefixes the name of the GCS object the rendered user-data is uploaded to, e.g. to namespace objects by pool."
+				},
+				"enable_shielded_vm": {
+					"type": "object",
+					"description": "Enables Shielded VM features on the instance.",
+					"properties": {
+						"secure_boot": {"type": "boolean"},
+						"vtpm": {"type": "boolean"},
+						"integrity_monitoring": {"type": "boolean"}
+					},
+					"additionalProperties": false
+				},
+				"enable_confidential_vm": {
+					"type": "object",
+					"description": "Enables Confidential VM on the instance. Requires a machine family that supports it (e.g. N2D, C2D, C3D).",
+					"properties": {
+						"confidential_instance_type": {
+							"type": "string",
+							"enum": ["SEV", "SEV_SNP", "TDX"]
+						}
+					},
+					"additionalProperties": false
+				},
+				"provisioning_model": {
+					"type": "string",
+					"enum": ["STANDARD", "SPOT"],
+					"description": "The provisioning model of the instance. Default is STANDARD."
+				},
+				"instance_termination_action": {
+					"type": "string",
+					"enum": ["STOP", "DELETE"],
+					"description": "What GCP should do when a SPOT instance is preempted. Only valid when provisioning_model is SPOT."
+				},
+				"service_account": {
+					"type": "object",
+					"description": "The service account to attach to the instance.",
+					"properties": {
+						"email": {"type": "string"},
+						"scopes": {
+							"type": "array",
+							"items": {"type": "string"}
+						}
+					},
+					"required": ["email"],
+					"additionalProperties": false
+				},
+				"accelerators": {
+					"type": "array",
+					"description": "A list of accelerators (GPUs) to attach to the instance. Forces on_host_maintenance to TERMINATE.",
+					"items": {
+						"type": "object",
+						"properties": {
+							"type": {"type": "string"},
+							"count": {"type": "integer"}
+						},
+						"required": ["type", "count"],
+						"additionalProperties": false
+					}
+				},
+				"additional_disks": {
+					"type": "array",
+					"description": "A list of additional disks to attach to the instance.",
+					"items": {
+						"type": "object",
+						"properties": {
+							"size_gb": {"type": "integer"},
+							"type": {"type": "string"},
+							"source_image": {"type": "string"},
+							"source_snapshot": {"type": "string"},
+							"auto_delete": {"type": "boolean"}
+						},
+						"additionalProperties": false
+					}
 				}
 			},
 			"additionalProperties": false
@@ -86,6 +173,22 @@ const (
 	`
 )
 
+// Exported label keys, so that callers outside this package (e.g. the
+// provider package, when listing or filtering instances) can build label
+// selectors without duplicating the literal values.
+const (
+	LabelPoolID         = garmPoolID
+	LabelControllerID   = garmControllerID
+	LabelOSType         = osType
+	LabelUserDataObject = "garmuserdataobject"
+)
+
+// UserDataFormatIgnition is the exported form of userDataFormatIgnition, so
+// that callers outside this package (e.g. the provider package, when
+// picking the metadata key the rendered user-data is attached under) can
+// compare against it without duplicating the literal value.
+const UserDataFormatIgnition = userDataFormatIgnition
+
 type ToolFetchFunc func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error)
 
 var DefaultToolFetch ToolFetchFunc = util.GetTools
@@ -156,17 +259,138 @@ func (e *extraSpecs) Validate() error {
 			return fmt.Errorf("network tag '%s' does not match requirements", tag)
 		}
 	}
+	if e.UserDataFormat != "" && e.UserDataFormat != userDataFormatIgnition {
+		return fmt.Errorf("invalid user_data_format '%s', only '%s' is supported", e.UserDataFormat, userDataFormatIgnition)
+	}
+
+	if e.UserDataTemplate != "" {
+		templateRegex, err := regexp.Compile(userDataTemplateRegex)
+		if err != nil {
+			return fmt.Errorf("invalid template name regex pattern: %w", err)
+		}
+		if !templateRegex.MatchString(e.UserDataTemplate) {
+			return fmt.Errorf("user_data_template '%s' does not match requirements", e.UserDataTemplate)
+		}
+	}
+	if e.UserDataObjectPrefix != "" {
+		prefixRegex, err := regexp.Compile(networkTagRegex)
+		if err != nil {
+			return fmt.Errorf("invalid object prefix regex pattern: %w", err)
+		}
+		if !prefixRegex.MatchString(e.UserDataObjectPrefix) {
+			return fmt.Errorf("user_data_object_prefix '%s' does not match requirements", e.UserDataObjectPrefix)
+		}
+	}
+
+	switch e.ProvisioningModel {
+	case "", ProvisioningModelStandard, ProvisioningModelSpot:
+	default:
+		return fmt.Errorf("invalid provisioning_model '%s'", e.ProvisioningModel)
+	}
+	if e.InstanceTerminationAction != "" && e.ProvisioningModel != ProvisioningModelSpot {
+		return fmt.Errorf("instance_termination_action is only valid when provisioning_model is %s", ProvisioningModelSpot)
+	}
+	switch e.InstanceTerminationAction {
+	case "", TerminationActionStop, TerminationActionDelete:
+	default:
+		return fmt.Errorf("invalid instance_termination_action '%s'", e.InstanceTerminationAction)
+	}
+
+	if e.EnableConfidentialVM != nil {
+		switch e.EnableConfidentialVM.ConfidentialInstanceType {
+		case ConfidentialInstanceTypeSEV, ConfidentialInstanceTypeSEVSNP, ConfidentialInstanceTypeTDX:
+		default:
+			return fmt.Errorf("invalid confidential_instance_type '%s'", e.EnableConfidentialVM.ConfidentialInstanceType)
+		}
+	}
+
+	if e.ServiceAccount != nil && e.ServiceAccount.Email == "" {
+		return fmt.Errorf("service_account.email is required when service_account is set")
+	}
+
+	for _, accel := range e.Accelerators {
+		if accel.Type == "" {
+			return fmt.Errorf("accelerator type cannot be empty")
+		}
+		if accel.Count <= 0 {
+			return fmt.Errorf("accelerator count must be greater than 0")
+		}
+	}
+
+	for _, disk := range e.AdditionalDisks {
+		if disk.SizeGB < 0 {
+			return fmt.Errorf("additional disk size_gb cannot be negative")
+		}
+	}
+
 	return nil
 }
 
+// ShieldedVMConfig controls the Shielded VM options applied to an instance.
+type ShieldedVMConfig struct {
+	SecureBoot          bool `json:"secure_boot,omitempty"`
+	VTPM                bool `json:"vtpm,omitempty"`
+	IntegrityMonitoring bool `json:"integrity_monitoring,omitempty"`
+}
+
+// ConfidentialVMConfig controls the Confidential Computing options applied
+// to an instance.
+type ConfidentialVMConfig struct {
+	ConfidentialInstanceType string `json:"confidential_instance_type,omitempty"`
+}
+
+// ServiceAccount is the service account attached to an instance.
+type ServiceAccount struct {
+	Email  string   `json:"email"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Accelerator describes a GPU or other accelerator attached to an instance.
+type Accelerator struct {
+	Type  string `json:"type"`
+	Count int64  `json:"count"`
+}
+
+// AdditionalDisk describes an extra disk attached to an instance, on top of
+// the boot disk.
+type AdditionalDisk struct {
+	SizeGB         int64  `json:"size_gb,omitempty"`
+	Type           string `json:"type,omitempty"`
+	SourceImage    string `json:"source_image,omitempty"`
+	SourceSnapshot string `json:"source_snapshot,omitempty"`
+	AutoDelete     bool   `json:"auto_delete,omitempty"`
+}
+
+const (
+	ProvisioningModelStandard string = "STANDARD"
+	ProvisioningModelSpot     string = "SPOT"
+
+	TerminationActionStop   string = "STOP"
+	TerminationActionDelete string = "DELETE"
+
+	ConfidentialInstanceTypeSEV    string = "SEV"
+	ConfidentialInstanceTypeSEVSNP string = "SEV_SNP"
+	ConfidentialInstanceTypeTDX    string = "TDX"
+)
+
 type extraSpecs struct {
-	DiskSize       int64             `json:"disksize,omitempty"`
-	NetworkID      string            `json:"network_id,omitempty"`
-	SubnetworkID   string            `json:"subnetwork_id,omitempty"`
-	NicType        string            `json:"nic_type,omitempty"`
-	CustomLabels   map[string]string `json:"custom_labels,omitempty"`
-	NetworkTags    []string          `json:"network_tags,omitempty"`
-	SourceSnapshot string            `json:"source_snapshot,omitempty"`
+	DiskSize                  int64                 `json:"disksize,omitempty"`
+	NetworkID                 string                `json:"network_id,omitempty"`
+	SubnetworkID              string                `json:"subnetwork_id,omitempty"`
+	NicType                   string                `json:"nic_type,omitempty"`
+	CustomLabels              map[string]string     `json:"custom_labels,omitempty"`
+	NetworkTags               []string              `json:"network_tags,omitempty"`
+	SourceSnapshot            string                `json:"source_snapshot,omitempty"`
+	UserDataFormat            string                `json:"user_data_format,omitempty"`
+	UserDataTemplate          string                `json:"user_data_template,omitempty"`
+	UserDataObjectPrefix      string                `json:"user_data_object_prefix,omitempty"`
+	EnableShieldedVM          *ShieldedVMConfig     `json:"enable_shielded_vm,omitempty"`
+	EnableConfidentialVM      *ConfidentialVMConfig `json:"enable_confidential_vm,omitempty"`
+	ProvisioningModel         string                `json:"provisioning_model,omitempty"`
+	InstanceTerminationAction string                `json:"instance_termination_action,omitempty"`
+	ServiceAccount            *ServiceAccount       `json:"service_account,omitempty"`
+	Accelerators              []Accelerator         `json:"accelerators,omitempty"`
+	AdditionalDisks           []AdditionalDisk      `json:"additional_disks,omitempty"`
 }
 
 func GetRunnerSpecFromBootstrapParams(cfg *config.Config, data params.BootstrapInstance, controllerID string) (*RunnerSpec, error) {
@@ -196,6 +420,8 @@ func GetRunnerSpecFromBootstrapParams(cfg *config.Config, data params.BootstrapI
 		NicType:         defaultNicType,
 		DiskSize:        defaultDiskSizeGB,
 		CustomLabels:    labels,
+		TemplateDir:     cfg.UserDataTemplateDir,
+		UserDataBucket:  cfg.UserDataBucket,
 	}
 
 	spec.MergeExtraSpecs(extraSpecs)
@@ -215,8 +441,38 @@ type RunnerSpec struct {
 	CustomLabels    map[string]string
 	NetworkTags     []string
 	SourceSnapshot  string
+	UserDataFormat  string
+	// UserDataTemplate is the name of the user-data template to render,
+	// taken from extra_specs.user_data_template. TemplateDir, in contrast,
+	// is provider-wide configuration, not a per-pool extra spec.
+	UserDataTemplate string
+	TemplateDir      string
+	// UserDataBucket and UserDataObjectPrefix control whether rendered
+	// user-data is embedded inline in instance metadata (the default) or
+	// uploaded to GCS and referenced via startup-script-url, which is
+	// required once the rendered document would exceed GCE's 256 KiB
+	// metadata value limit. UserDataBucket is provider-wide configuration;
+	// UserDataObjectPrefix is the per-pool extra spec override.
+	UserDataBucket       string
+	UserDataObjectPrefix string
+
+	EnableShieldedVM          *ShieldedVMConfig
+	EnableConfidentialVM      *ConfidentialVMConfig
+	ProvisioningModel         string
+	InstanceTerminationAction string
+	ServiceAccount            *ServiceAccount
+	Accelerators              []Accelerator
+	AdditionalDisks           []AdditionalDisk
+	// OnHostMaintenance is derived rather than taken directly from
+	// extraSpecs: GCP requires it to be TERMINATE whenever accelerators are
+	// attached, and it cannot be MIGRATE for SPOT instances either.
+	OnHostMaintenance string
 }
 
+// confidentialVMMachineFamilies lists the machine type prefixes that
+// support Confidential Computing on GCP.
+var confidentialVMMachineFamilies = []string{"n2d-", "c2d-", "c3d-"}
+
 func (r *RunnerSpec) MergeExtraSpecs(extraSpecs *extraSpecs) {
 	if extraSpecs.NetworkID != "" {
 		r.NetworkID = extraSpecs.NetworkID
@@ -239,6 +495,42 @@ func (r *RunnerSpec) MergeExtraSpecs(extraSpecs *extraSpecs) {
 	if extraSpecs.SourceSnapshot != "" {
 		r.SourceSnapshot = extraSpecs.SourceSnapshot
 	}
+	if extraSpecs.UserDataFormat != "" {
+		r.UserDataFormat = extraSpecs.UserDataFormat
+	}
+	if extraSpecs.UserDataTemplate != "" {
+		r.UserDataTemplate = extraSpecs.UserDataTemplate
+	}
+	if extraSpecs.UserDataObjectPrefix != "" {
+		r.UserDataObjectPrefix = extraSpecs.UserDataObjectPrefix
+	}
+	if extraSpecs.EnableShieldedVM != nil {
+		r.EnableShieldedVM = extraSpecs.EnableShieldedVM
+	}
+	if extraSpecs.EnableConfidentialVM != nil {
+		r.EnableConfidentialVM = extraSpecs.EnableConfidentialVM
+	}
+	if extraSpecs.ProvisioningModel != "" {
+		r.ProvisioningModel = extraSpecs.ProvisioningModel
+	}
+	if extraSpecs.InstanceTerminationAction != "" {
+		r.InstanceTerminationAction = extraSpecs.InstanceTerminationAction
+	}
+	if extraSpecs.ServiceAccount != nil {
+		r.ServiceAccount = extraSpecs.ServiceAccount
+	}
+	if len(extraSpecs.Accelerators) > 0 {
+		r.Accelerators = extraSpecs.Accelerators
+	}
+	if len(extraSpecs.AdditionalDisks) > 0 {
+		r.AdditionalDisks = extraSpecs.AdditionalDisks
+	}
+
+	if len(r.Accelerators) > 0 || r.ProvisioningModel == ProvisioningModelSpot {
+		// Accelerators and SPOT instances are not supported with live
+		// migration.
+		r.OnHostMaintenance = "TERMINATE"
+	}
 }
 
 func (r *RunnerSpec) Validate() error {
@@ -257,10 +549,35 @@ func (r *RunnerSpec) Validate() error {
 	if r.NicType == "" {
 		return fmt.Errorf("missing nic type")
 	}
+	if r.EnableConfidentialVM != nil {
+		supported := false
+		for _, family := range confidentialVMMachineFamilies {
+			if strings.HasPrefix(r.BootstrapParams.Flavor, family) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("machine type '%s' does not support confidential VMs", r.BootstrapParams.Flavor)
+		}
+	}
 
 	return nil
 }
 
+// UserDataObjectName returns the name of the GCS object the rendered
+// user-data is uploaded to when UserDataBucket is configured and the
+// user-data format is not Ignition (Ignition is always inline). It is stored
+// back on the instance as the LabelUserDataObject label, so that
+// DeleteInstance can find the object to clean up given only an instance
+// name.
+func (r RunnerSpec) UserDataObjectName() string {
+	if r.UserDataObjectPrefix != "" {
+		return r.UserDataObjectPrefix + "-" + r.BootstrapParams.Name
+	}
+	return r.BootstrapParams.Name
+}
+
 func (r RunnerSpec) ComposeUserData() (string, error) {
 	switch r.BootstrapParams.OSType {
 	case params.Linux:
@@ -269,30 +586,56 @@ func (r RunnerSpec) ComposeUserData() (string, error) {
 			return "", fmt.Errorf("failed to generate userdata: %w", err)
 		}
 
-		asBase64 := base64.StdEncoding.EncodeToString(udata)
-		scriptCommands := []string{
-			"sudo useradd -m " + defaults.DefaultUser + " || true",
-			// Create the runner home directory if it doesn't exist
-			"sudo mkdir -p /home/" + defaults.DefaultUser,
-			// Add user to sudoers
-			"sudo usermod -aG sudo " + defaults.DefaultUser,
-			// Check curl and tar are installed
-			"sudo apt-get update && sudo apt-get install -y curl tar",
-			// Install the runner
-			"echo " + asBase64 + " | base64 -d > /install_runner.sh",
-			"chmod +x /install_runner.sh",
-			"echo 'runner  ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/garm",
-			"su -l -c /install_runner.sh " + defaults.DefaultUser,
+		if r.UserDataFormat == userDataFormatIgnition {
+			ign, err := composeIgnitionUserData(udata)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate ignition userdata: %w", err)
+			}
+			return ign, nil
 		}
-		script := strings.Join(scriptCommands, "\n")
-		return script, nil
+
+		return r.renderUserDataTemplate(udata, defaultLinuxUserDataTemplate)
 	case params.Windows:
 		udata, err := cloudconfig.GetRunnerInstallScript(r.BootstrapParams, r.Tools, r.BootstrapParams.Name)
 		if err != nil {
 			return "", fmt.Errorf("failed to generate userdata: %w", err)
 		}
 
-		return string(udata), nil
+		return r.renderUserDataTemplate(udata, defaultWindowsUserDataTemplate)
 	}
 	return "", fmt.Errorf("unsupported OS type for cloud config: %s", r.BootstrapParams.OSType)
 }
+
+// renderUserDataTemplate renders the user-data template selected via
+// extra_specs.user_data_template (falling back to defaultTemplate) against
+// the runner install script.
+func (r RunnerSpec) renderUserDataTemplate(installScript []byte, defaultTemplate string) (string, error) {
+	templateName := r.UserDataTemplate
+	if templateName == "" {
+		templateName = defaultTemplate
+	}
+
+	ctx := userDataTemplateContext{
+		Tools:            r.Tools,
+		BootstrapParams:  r.BootstrapParams,
+		DefaultUser:      defaults.DefaultUser,
+		InstallScript:    string(installScript),
+		InstallScriptB64: base64.StdEncoding.EncodeToString(installScript),
+		CustomLabels:     r.CustomLabels,
+	}
+
+	// The GCE metadata value size limit only matters for the inline path:
+	// once UserDataBucket is configured, an oversized document is uploaded
+	// to GCS instead of embedded in instance metadata (see
+	// composeUserDataMetadata), so it must not be rejected here.
+	maxSize := maxUserDataSize
+	if r.UserDataBucket != "" {
+		maxSize = 0
+	}
+
+	rendered, err := renderUserData(templateName, r.TemplateDir, ctx, maxSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to render user data: %w", err)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import "testing"
+
+func TestMergeExtraSpecsSpotForcesTerminateOnHostMaintenance(t *testing.T) {
+	r := &RunnerSpec{}
+	r.MergeExtraSpecs(&extraSpecs{ProvisioningModel: ProvisioningModelSpot})
+
+	if r.OnHostMaintenance != "TERMINATE" {
+		t.Fatalf("expected SPOT provisioning to force OnHostMaintenance to TERMINATE, got %q", r.OnHostMaintenance)
+	}
+}
+
+func TestMergeExtraSpecsStandardLeavesOnHostMaintenanceUnset(t *testing.T) {
+	r := &RunnerSpec{}
+	r.MergeExtraSpecs(&extraSpecs{ProvisioningModel: ProvisioningModelStandard})
+
+	if r.OnHostMaintenance != "" {
+		t.Fatalf("expected STANDARD provisioning to leave OnHostMaintenance unset, got %q", r.OnHostMaintenance)
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/cloudbase/garm-provider-common/params"
+)
+
+// maxUserDataSize is the GCE limit for a single instance metadata value.
+const maxUserDataSize = 256 * 1024
+
+const (
+	defaultLinuxUserDataTemplate   string = "debian"
+	defaultWindowsUserDataTemplate string = "windows"
+)
+
+// userDataTemplateContext is the data made available to user-data
+// templates, both built-in and custom.
+type userDataTemplateContext struct {
+	Tools            params.RunnerApplicationDownload
+	BootstrapParams  params.BootstrapInstance
+	DefaultUser      string
+	InstallScript    string
+	InstallScriptB64 string
+	CustomLabels     map[string]string
+}
+
+var userDataFuncMap = template.FuncMap{
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"join": func(sep string, items []string) string {
+		return strings.Join(items, sep)
+	},
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		lines := strings.Split(s, "\n")
+		for i := range lines {
+			lines[i] = pad + lines[i]
+		}
+		return strings.Join(lines, "\n")
+	},
+	"env": os.Getenv,
+	"file": func(path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return string(data), nil
+	},
+}
+
+// builtinUserDataTemplates ship with the provider, covering the image
+// families garm-provider-gcp supports out of the box. Operators that need
+// something else can point config.Config.UserDataTemplateDir at a
+// directory of their own "<name>.tmpl" files instead.
+var builtinUserDataTemplates = map[string]string{
+	"debian": `#!/bin/bash
+sudo useradd -m {{ .DefaultUser }} || true
+sudo mkdir -p /home/{{ .DefaultUser }}
+sudo usermod -aG sudo {{ .DefaultUser }}
+sudo apt-get update && sudo apt-get install -y curl tar
+echo {{ .InstallScriptB64 }} | base64 -d > /install_runner.sh
+chmod +x /install_runner.sh
+echo '{{ .DefaultUser }}  ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/garm
+su -l -c /install_runner.sh {{ .DefaultUser }}
+`,
+	"rhel": `#!/bin/bash
+sudo useradd -m {{ .DefaultUser }} || true
+sudo mkdir -p /home/{{ .DefaultUser }}
+sudo usermod -aG wheel {{ .DefaultUser }}
+sudo dnf install -y curl tar
+echo {{ .InstallScriptB64 }} | base64 -d > /install_runner.sh
+chmod +x /install_runner.sh
+echo '{{ .DefaultUser }}  ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/garm
+su -l -c /install_runner.sh {{ .DefaultUser }}
+`,
+	"suse": `#!/bin/bash
+sudo useradd -m {{ .DefaultUser }} || true
+sudo mkdir -p /home/{{ .DefaultUser }}
+sudo usermod -aG wheel {{ .DefaultUser }}
+sudo zypper --non-interactive install curl tar
+echo {{ .InstallScriptB64 }} | base64 -d > /install_runner.sh
+chmod +x /install_runner.sh
+echo '{{ .DefaultUser }}  ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/garm
+su -l -c /install_runner.sh {{ .DefaultUser }}
+`,
+	"windows": `{{ .InstallScript }}`,
+}
+
+// loadUserDataTemplate returns the raw (un-rendered) template text for
+// name, preferring a "<name>.tmpl" file under templateDir when one exists.
+func loadUserDataTemplate(name, templateDir string) (string, error) {
+	if templateDir != "" {
+		path := filepath.Join(templateDir, name+".tmpl")
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			return string(data), nil
+		case !os.IsNotExist(err):
+			return "", fmt.Errorf("failed to read custom user data template %s: %w", path, err)
+		}
+	}
+
+	tmpl, ok := builtinUserDataTemplates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown user data template %q", name)
+	}
+	return tmpl, nil
+}
+
+// renderUserData renders the named user-data template against ctx,
+// looking it up under templateDir first and falling back to the built-in
+// templates. The rendered document is rejected if it is empty, or if it
+// exceeds maxSize bytes. maxSize <= 0 disables the size check, which the
+// caller does once the rendered document is going to be offloaded to GCS
+// rather than embedded in instance metadata.
+func renderUserData(name, templateDir string, ctx userDataTemplateContext, maxSize int) (string, error) {
+	tmplText, err := loadUserDataTemplate(name, templateDir)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(name).Funcs(userDataFuncMap).Parse(tmplText)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse user data template %q: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return "", fmt.Errorf("failed to render user data template %q: %w", name, err)
+	}
+
+	rendered := buf.String()
+	if strings.TrimSpace(rendered) == "" {
+		return "", fmt.Errorf("user data template %q rendered an empty document", name)
+	}
+	if maxSize > 0 && len(rendered) > maxSize {
+		return "", fmt.Errorf("user data template %q rendered %d bytes, which exceeds the %d byte GCE metadata value limit", name, len(rendered), maxSize)
+	}
+
+	return rendered, nil
+}
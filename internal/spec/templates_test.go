@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderUserDataBuiltinTemplate(t *testing.T) {
+	ctx := userDataTemplateContext{
+		DefaultUser:      "runner",
+		InstallScriptB64: "ZWNobyBoaQo=",
+	}
+
+	rendered, err := renderUserData("debian", "", ctx, maxUserDataSize)
+	if err != nil {
+		t.Fatalf("renderUserData returned an error: %s", err)
+	}
+	if !strings.Contains(rendered, "ZWNobyBoaQo=") {
+		t.Fatalf("rendered template does not contain the install script: %s", rendered)
+	}
+}
+
+func TestRenderUserDataCustomTemplateDirTakesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "debian.tmpl"), []byte("custom-{{ .DefaultUser }}"), 0o644); err != nil {
+		t.Fatalf("failed to write custom template: %s", err)
+	}
+
+	rendered, err := renderUserData("debian", dir, userDataTemplateContext{DefaultUser: "runner"}, maxUserDataSize)
+	if err != nil {
+		t.Fatalf("renderUserData returned an error: %s", err)
+	}
+	if rendered != "custom-runner" {
+		t.Fatalf("expected custom template to take precedence, got: %s", rendered)
+	}
+}
+
+func TestRenderUserDataRejectsEmptyDocument(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.tmpl"), []byte("   "), 0o644); err != nil {
+		t.Fatalf("failed to write custom template: %s", err)
+	}
+
+	if _, err := renderUserData("empty", dir, userDataTemplateContext{}, maxUserDataSize); err == nil {
+		t.Fatal("expected an error for an empty rendered document")
+	}
+}
+
+func TestRenderUserDataRejectsOversizedDocument(t *testing.T) {
+	dir := t.TempDir()
+	oversized := strings.Repeat("a", maxUserDataSize+1)
+	if err := os.WriteFile(filepath.Join(dir, "big.tmpl"), []byte(oversized), 0o644); err != nil {
+		t.Fatalf("failed to write custom template: %s", err)
+	}
+
+	if _, err := renderUserData("big", dir, userDataTemplateContext{}, maxUserDataSize); err == nil {
+		t.Fatal("expected an error for a document exceeding the GCE metadata value limit")
+	}
+}
+
+func TestRenderUserDataSkipsSizeLimitWhenDisabled(t *testing.T) {
+	dir := t.TempDir()
+	oversized := strings.Repeat("a", maxUserDataSize+1)
+	if err := os.WriteFile(filepath.Join(dir, "big.tmpl"), []byte(oversized), 0o644); err != nil {
+		t.Fatalf("failed to write custom template: %s", err)
+	}
+
+	rendered, err := renderUserData("big", dir, userDataTemplateContext{}, 0)
+	if err != nil {
+		t.Fatalf("renderUserData returned an error: %s", err)
+	}
+	if len(rendered) != len(oversized) {
+		t.Fatalf("expected the oversized document to be rendered in full, got %d bytes", len(rendered))
+	}
+}
+
+func TestRenderUserDataTemplateSkipsSizeLimitWhenOffloading(t *testing.T) {
+	dir := t.TempDir()
+	oversized := strings.Repeat("a", maxUserDataSize+1)
+	if err := os.WriteFile(filepath.Join(dir, "big.tmpl"), []byte(oversized), 0o644); err != nil {
+		t.Fatalf("failed to write custom template: %s", err)
+	}
+
+	r := RunnerSpec{TemplateDir: dir, UserDataTemplate: "big", UserDataBucket: "runner-userdata"}
+	rendered, err := r.renderUserDataTemplate(nil, "big")
+	if err != nil {
+		t.Fatalf("renderUserDataTemplate returned an error: %s", err)
+	}
+	if len(rendered) != len(oversized) {
+		t.Fatalf("expected the oversized document to be rendered in full when UserDataBucket is set, got %d bytes", len(rendered))
+	}
+}
@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/proto"
+
+	commonParams "github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/internal/client"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+// buildInstanceRequest translates a RunnerSpec into the GCE instance
+// resource that will be sent to the Insert API call. The user-data
+// metadata entry is composed by the caller and passed in as
+// metadataKey/metadataValue, since composing it may require uploading an
+// object to GCS (see composeUserDataMetadata).
+func buildInstanceRequest(runnerSpec *spec.RunnerSpec, metadataKey, metadataValue string) (*computepb.Instance, error) {
+	instance := &computepb.Instance{
+		Name:        proto.String(runnerSpec.BootstrapParams.Name),
+		MachineType: proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", runnerSpec.Zone, runnerSpec.BootstrapParams.Flavor)),
+		Labels:      runnerSpec.CustomLabels,
+		Tags: &computepb.Tags{
+			Items: runnerSpec.NetworkTags,
+		},
+		Disks: []*computepb.AttachedDisk{
+			{
+				AutoDelete: proto.Bool(true),
+				Boot:       proto.Bool(true),
+				InitializeParams: &computepb.AttachedDiskInitializeParams{
+					DiskSizeGb: proto.Int64(runnerSpec.DiskSize),
+				},
+			},
+		},
+		NetworkInterfaces: []*computepb.NetworkInterface{
+			{
+				Network:    proto.String(runnerSpec.NetworkID),
+				Subnetwork: proto.String(runnerSpec.SubnetworkID),
+			},
+		},
+		Metadata: &computepb.Metadata{
+			Items: []*computepb.Items{
+				{
+					Key:   proto.String(metadataKey),
+					Value: proto.String(metadataValue),
+				},
+			},
+		},
+	}
+
+	if runnerSpec.SourceSnapshot != "" {
+		instance.Disks[0].InitializeParams.SourceSnapshot = proto.String(runnerSpec.SourceSnapshot)
+	}
+
+	if runnerSpec.NicType != "" {
+		instance.NetworkInterfaces[0].NicType = proto.String(runnerSpec.NicType)
+	}
+
+	for _, disk := range runnerSpec.AdditionalDisks {
+		initializeParams := &computepb.AttachedDiskInitializeParams{
+			DiskSizeGb: proto.Int64(disk.SizeGB),
+		}
+		if disk.Type != "" {
+			initializeParams.DiskType = proto.String(fmt.Sprintf("zones/%s/diskTypes/%s", runnerSpec.Zone, disk.Type))
+		}
+		if disk.SourceImage != "" {
+			initializeParams.SourceImage = proto.String(disk.SourceImage)
+		}
+		if disk.SourceSnapshot != "" {
+			initializeParams.SourceSnapshot = proto.String(disk.SourceSnapshot)
+		}
+
+		instance.Disks = append(instance.Disks, &computepb.AttachedDisk{
+			AutoDelete:       proto.Bool(disk.AutoDelete),
+			InitializeParams: initializeParams,
+		})
+	}
+
+	if runnerSpec.EnableShieldedVM != nil {
+		instance.ShieldedInstanceConfig = &computepb.ShieldedInstanceConfig{
+			EnableSecureBoot:          proto.Bool(runnerSpec.EnableShieldedVM.SecureBoot),
+			EnableVtpm:                proto.Bool(runnerSpec.EnableShieldedVM.VTPM),
+			EnableIntegrityMonitoring: proto.Bool(runnerSpec.EnableShieldedVM.IntegrityMonitoring),
+		}
+	}
+
+	if runnerSpec.EnableConfidentialVM != nil {
+		instance.ConfidentialInstanceConfig = &computepb.ConfidentialInstanceConfig{
+			ConfidentialInstanceType: proto.String(runnerSpec.EnableConfidentialVM.ConfidentialInstanceType),
+		}
+	}
+
+	if runnerSpec.ServiceAccount != nil {
+		instance.ServiceAccounts = []*computepb.ServiceAccount{
+			{
+				Email:  proto.String(runnerSpec.ServiceAccount.Email),
+				Scopes: runnerSpec.ServiceAccount.Scopes,
+			},
+		}
+	}
+
+	for _, accel := range runnerSpec.Accelerators {
+		instance.GuestAccelerators = append(instance.GuestAccelerators, &computepb.AcceleratorConfig{
+			AcceleratorType:  proto.String(fmt.Sprintf("zones/%s/acceleratorTypes/%s", runnerSpec.Zone, accel.Type)),
+			AcceleratorCount: proto.Int32(int32(accel.Count)),
+		})
+	}
+
+	if runnerSpec.ProvisioningModel != "" || runnerSpec.OnHostMaintenance != "" {
+		instance.Scheduling = &computepb.Scheduling{}
+		if runnerSpec.ProvisioningModel != "" {
+			instance.Scheduling.ProvisioningModel = proto.String(runnerSpec.ProvisioningModel)
+		}
+		if runnerSpec.InstanceTerminationAction != "" {
+			instance.Scheduling.InstanceTerminationAction = proto.String(runnerSpec.InstanceTerminationAction)
+		}
+		if runnerSpec.OnHostMaintenance != "" {
+			instance.Scheduling.OnHostMaintenance = proto.String(runnerSpec.OnHostMaintenance)
+		}
+	}
+
+	return instance, nil
+}
+
+func instanceToProviderInstance(instance *computepb.Instance) commonParams.ProviderInstance {
+	status := commonParams.InstanceRunning
+	if instance.GetStatus() != "RUNNING" {
+		status = commonParams.InstanceStopped
+	}
+
+	return commonParams.ProviderInstance{
+		ProviderID: instance.GetName(),
+		Name:       instance.GetName(),
+		OSType:     commonParams.OSType(instance.GetLabels()[spec.LabelOSType]),
+		Status:     status,
+	}
+}
+
+func createInstance(ctx context.Context, cli *client.GcpCli, runnerSpec *spec.RunnerSpec) (commonParams.ProviderInstance, error) {
+	metadataKey, metadataValue, err := composeUserDataMetadata(ctx, cli, runnerSpec)
+	if err != nil {
+		return commonParams.ProviderInstance{}, fmt.Errorf("failed to compose user data: %w", err)
+	}
+	if shouldOffloadUserData(runnerSpec) {
+		runnerSpec.CustomLabels[spec.LabelUserDataObject] = runnerSpec.UserDataObjectName()
+	}
+
+	instanceResource, err := buildInstanceRequest(runnerSpec, metadataKey, metadataValue)
+	if err != nil {
+		return commonParams.ProviderInstance{}, fmt.Errorf("failed to build instance request: %w", err)
+	}
+
+	op, err := cli.Instances().Insert(ctx, &computepb.InsertInstanceRequest{
+		Project:          cli.ProjectID(),
+		Zone:             runnerSpec.Zone,
+		InstanceResource: instanceResource,
+	})
+	if err != nil {
+		return commonParams.ProviderInstance{}, fmt.Errorf("failed to create instance: %w", err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return commonParams.ProviderInstance{}, fmt.Errorf("failed to wait for instance creation: %w", err)
+	}
+
+	return getInstance(ctx, cli, runnerSpec.BootstrapParams.Name)
+}
+
+func getInstance(ctx context.Context, cli *client.GcpCli, instance string) (commonParams.ProviderInstance, error) {
+	resp, err := cli.Instances().Get(ctx, &computepb.GetInstanceRequest{
+		Project:  cli.ProjectID(),
+		Zone:     cli.Zone(),
+		Instance: instance,
+	})
+	if err != nil {
+		return commonParams.ProviderInstance{}, fmt.Errorf("failed to get instance %s: %w", instance, err)
+	}
+
+	return instanceToProviderInstance(resp), nil
+}
+
+func deleteInstance(ctx context.Context, cli *client.GcpCli, instance string) error {
+	if cli.UserDataBucket() != "" {
+		if resp, err := cli.Instances().Get(ctx, &computepb.GetInstanceRequest{
+			Project:  cli.ProjectID(),
+			Zone:     cli.Zone(),
+			Instance: instance,
+		}); err == nil {
+			objectName := resp.GetLabels()[spec.LabelUserDataObject]
+			if err := deleteUserDataObject(ctx, cli, objectName); err != nil {
+				// Best-effort: a leaked user-data object does not warrant
+				// keeping the (now unwanted) compute instance around.
+				log.Printf("failed to delete user data object for instance %s: %s", instance, err)
+			}
+		}
+	}
+
+	op, err := cli.Instances().Delete(ctx, &computepb.DeleteInstanceRequest{
+		Project:  cli.ProjectID(),
+		Zone:     cli.Zone(),
+		Instance: instance,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete instance %s: %w", instance, err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to wait for instance %s deletion: %w", instance, err)
+	}
+	return nil
+}
+
+// listInstancesWithFilter lists every instance in the default zone matching
+// the given GCE label filter expression.
+func listInstancesWithFilter(ctx context.Context, cli *client.GcpCli, filter string) ([]commonParams.ProviderInstance, error) {
+	it := cli.Instances().List(ctx, &computepb.ListInstancesRequest{
+		Project: cli.ProjectID(),
+		Zone:    cli.Zone(),
+		Filter:  proto.String(filter),
+	})
+
+	var ret []commonParams.ProviderInstance
+	for {
+		instance, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances: %w", err)
+		}
+		ret = append(ret, instanceToProviderInstance(instance))
+	}
+	return ret, nil
+}
+
+func listInstances(ctx context.Context, cli *client.GcpCli, poolID string) ([]commonParams.ProviderInstance, error) {
+	filter := fmt.Sprintf("labels.%s=%s", spec.LabelPoolID, poolID)
+	return listInstancesWithFilter(ctx, cli, filter)
+}
+
+func removeAllInstances(ctx context.Context, cli *client.GcpCli, controllerID string) error {
+	filter := fmt.Sprintf("labels.%s=%s", spec.LabelControllerID, controllerID)
+	instances, err := listInstancesWithFilter(ctx, cli, filter)
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	for _, instance := range instances {
+		if err := deleteInstance(ctx, cli, instance.Name); err != nil {
+			return fmt.Errorf("failed to delete instance %s: %w", instance.Name, err)
+		}
+	}
+	return nil
+}
+
+func stopInstance(ctx context.Context, cli *client.GcpCli, instance string) error {
+	op, err := cli.Instances().Stop(ctx, &computepb.StopInstanceRequest{
+		Project:  cli.ProjectID(),
+		Zone:     cli.Zone(),
+		Instance: instance,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop instance %s: %w", instance, err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to wait for instance %s to stop: %w", instance, err)
+	}
+	return nil
+}
+
+func startInstance(ctx context.Context, cli *client.GcpCli, instance string) error {
+	op, err := cli.Instances().Start(ctx, &computepb.StartInstanceRequest{
+		Project:  cli.ProjectID(),
+		Zone:     cli.Zone(),
+		Instance: instance,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start instance %s: %w", instance, err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to wait for instance %s to start: %w", instance, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"testing"
+
+	commonParams "github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+func baseRunnerSpec() *spec.RunnerSpec {
+	return &spec.RunnerSpec{
+		Zone:         "us-central1-a",
+		NetworkID:    "default",
+		SubnetworkID: "default",
+		DiskSize:     127,
+		CustomLabels: map[string]string{},
+		BootstrapParams: commonParams.BootstrapInstance{
+			Name:   "runner",
+			Flavor: "n1-standard-2",
+		},
+	}
+}
+
+func TestBuildInstanceRequestAdditionalDiskOmitsUnsetFields(t *testing.T) {
+	runnerSpec := baseRunnerSpec()
+	runnerSpec.AdditionalDisks = []spec.AdditionalDisk{
+		{SizeGB: 50},
+	}
+
+	instance, err := buildInstanceRequest(runnerSpec, "startup-script", "")
+	if err != nil {
+		t.Fatalf("buildInstanceRequest returned an error: %s", err)
+	}
+
+	if len(instance.Disks) != 2 {
+		t.Fatalf("expected a boot disk and one additional disk, got %d", len(instance.Disks))
+	}
+	additional := instance.Disks[1].InitializeParams
+	if additional.DiskType != nil {
+		t.Fatalf("expected DiskType to be unset, got %q", additional.GetDiskType())
+	}
+	if additional.SourceImage != nil {
+		t.Fatalf("expected SourceImage to be unset, got %q", additional.GetSourceImage())
+	}
+	if additional.SourceSnapshot != nil {
+		t.Fatalf("expected SourceSnapshot to be unset, got %q", additional.GetSourceSnapshot())
+	}
+}
+
+func TestBuildInstanceRequestAdditionalDiskTypeIsZoneQualified(t *testing.T) {
+	runnerSpec := baseRunnerSpec()
+	runnerSpec.AdditionalDisks = []spec.AdditionalDisk{
+		{SizeGB: 50, Type: "pd-ssd"},
+	}
+
+	instance, err := buildInstanceRequest(runnerSpec, "startup-script", "")
+	if err != nil {
+		t.Fatalf("buildInstanceRequest returned an error: %s", err)
+	}
+
+	want := "zones/us-central1-a/diskTypes/pd-ssd"
+	if got := instance.Disks[1].InitializeParams.GetDiskType(); got != want {
+		t.Fatalf("expected disk type %q, got %q", want, got)
+	}
+}
+
+func TestBuildInstanceRequestAcceleratorTypeIsZoneQualified(t *testing.T) {
+	runnerSpec := baseRunnerSpec()
+	runnerSpec.Accelerators = []spec.Accelerator{
+		{Type: "nvidia-tesla-t4", Count: 1},
+	}
+
+	instance, err := buildInstanceRequest(runnerSpec, "startup-script", "")
+	if err != nil {
+		t.Fatalf("buildInstanceRequest returned an error: %s", err)
+	}
+
+	want := "zones/us-central1-a/acceleratorTypes/nvidia-tesla-t4"
+	if got := instance.GuestAccelerators[0].GetAcceleratorType(); got != want {
+		t.Fatalf("expected accelerator type %q, got %q", want, got)
+	}
+}
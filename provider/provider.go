@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package provider implements the garm external-provider interface for GCP.
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/config"
+	"github.com/cloudbase/garm-provider-gcp/internal/client"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+// Version is the external-provider interface version implemented by this
+// provider. It is returned by GetVersion() as part of the garm <-> provider
+// handshake.
+const Version = "v0.1.4"
+
+// supportedInterfaceVersions lists every external-provider interface
+// version this provider is able to speak, oldest first.
+var supportedInterfaceVersions = []string{"v0.1.0", "v0.1.1", "v0.1.2", "v0.1.3", Version}
+
+// GcpProvider implements the garm-provider-common execution.ExternalProvider
+// interface for Google Compute Engine.
+type GcpProvider struct {
+	cfg          *config.Config
+	controllerID string
+}
+
+// NewGcpProvider returns a GcpProvider for the given controller, configured
+// from the provider config file at cfgFile.
+func NewGcpProvider(cfgFile, controllerID string) (*GcpProvider, error) {
+	cfg, err := config.NewConfig(cfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+
+	return &GcpProvider{
+		cfg:          cfg,
+		controllerID: controllerID,
+	}, nil
+}
+
+func (g *GcpProvider) client(ctx context.Context) (*client.GcpCli, error) {
+	return client.NewGcpCli(ctx, g.cfg)
+}
+
+// GetVersion returns the external-provider interface version this provider
+// implements.
+func (g *GcpProvider) GetVersion(_ context.Context) (string, error) {
+	return Version, nil
+}
+
+// GetSupportedInterfaceVersions returns every external-provider interface
+// version this provider is able to speak.
+func (g *GcpProvider) GetSupportedInterfaceVersions(_ context.Context) ([]string, error) {
+	return supportedInterfaceVersions, nil
+}
+
+// ValidatePoolInfo builds a RunnerSpec out of the bootstrap params a pool
+// would use, without creating an instance, so that malformed extra_specs
+// are rejected at pool creation time rather than at instance-create time.
+func (g *GcpProvider) ValidatePoolInfo(_ context.Context, bootstrapParams params.BootstrapInstance) error {
+	runnerSpec, err := spec.GetRunnerSpecFromBootstrapParams(g.cfg, bootstrapParams, g.controllerID)
+	if err != nil {
+		return fmt.Errorf("failed to validate pool info: %w", err)
+	}
+	if err := runnerSpec.Validate(); err != nil {
+		return fmt.Errorf("failed to validate pool info: %w", err)
+	}
+	return nil
+}
+
+func (g *GcpProvider) CreateInstance(ctx context.Context, bootstrapParams params.BootstrapInstance) (params.ProviderInstance, error) {
+	runnerSpec, err := spec.GetRunnerSpecFromBootstrapParams(g.cfg, bootstrapParams, g.controllerID)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("failed to get runner spec: %w", err)
+	}
+
+	cli, err := g.client(ctx)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return createInstance(ctx, cli, runnerSpec)
+}
+
+func (g *GcpProvider) GetInstance(ctx context.Context, instance string) (params.ProviderInstance, error) {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return getInstance(ctx, cli, instance)
+}
+
+func (g *GcpProvider) DeleteInstance(ctx context.Context, instance string) error {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return deleteInstance(ctx, cli, instance)
+}
+
+func (g *GcpProvider) ListInstances(ctx context.Context, poolID string) ([]params.ProviderInstance, error) {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return listInstances(ctx, cli, poolID)
+}
+
+func (g *GcpProvider) RemoveAllInstances(ctx context.Context) error {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return removeAllInstances(ctx, cli, g.controllerID)
+}
+
+func (g *GcpProvider) Stop(ctx context.Context, instance string) error {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return stopInstance(ctx, cli, instance)
+}
+
+func (g *GcpProvider) Start(ctx context.Context, instance string) error {
+	cli, err := g.client(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get gcp client: %w", err)
+	}
+	defer cli.Close()
+
+	return startInstance(ctx, cli, instance)
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	commonParams "github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/config"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+// stubToolFetch replaces spec.DefaultToolFetch so that ValidatePoolInfo does
+// not need a runner tools list matching the bootstrap params; the tests here
+// only care about extra_specs validation.
+func stubToolFetch(t *testing.T) {
+	t.Helper()
+	orig := spec.DefaultToolFetch
+	spec.DefaultToolFetch = func(_ commonParams.OSType, _ commonParams.OSArch, _ []commonParams.RunnerApplicationDownload) (commonParams.RunnerApplicationDownload, error) {
+		return commonParams.RunnerApplicationDownload{}, nil
+	}
+	t.Cleanup(func() { spec.DefaultToolFetch = orig })
+}
+
+func TestValidatePoolInfoSpotWithoutAcceleratorsPasses(t *testing.T) {
+	stubToolFetch(t)
+
+	g := &GcpProvider{
+		cfg: &config.Config{
+			Zone:         "us-central1-a",
+			NetworkID:    "default",
+			SubnetworkID: "default",
+		},
+		controllerID: "controller",
+	}
+
+	bootstrapParams := commonParams.BootstrapInstance{
+		Name:       "runner",
+		Flavor:     "n1-standard-2",
+		OSType:     commonParams.Linux,
+		ExtraSpecs: json.RawMessage(`{"provisioning_model": "SPOT"}`),
+	}
+
+	// ValidatePoolInfo does not look at OnHostMaintenance; that SPOT forces
+	// it to TERMINATE is checked by the MergeExtraSpecs tests in the spec
+	// package. This only checks that a SPOT pool is accepted.
+	if err := g.ValidatePoolInfo(context.Background(), bootstrapParams); err != nil {
+		t.Fatalf("ValidatePoolInfo returned an error for a valid SPOT pool: %s", err)
+	}
+}
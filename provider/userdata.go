@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+
+	commonParams "github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/internal/client"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+// signedURLTTL is how long a signed GCS URL handed to an instance's
+// startup-script-url metadata remains valid. The instance only needs to
+// fetch it once, early in its first boot.
+const signedURLTTL = 1 * time.Hour
+
+// userDataMetadataKey returns the GCE metadata key the rendered user data
+// (or a pointer to it) should be attached under, based on the runner's OS
+// and user-data format. Ignition documents are consumed by afterburn (on
+// Flatcar/Fedora CoreOS images), which reads them from the "user-data" key
+// regardless of OS-guest-agent conventions, so that check takes priority
+// over the OSType-based ones below.
+func userDataMetadataKey(runnerSpec *spec.RunnerSpec, offloaded bool) string {
+	switch {
+	case runnerSpec.UserDataFormat == spec.UserDataFormatIgnition:
+		return "user-data"
+	case runnerSpec.BootstrapParams.OSType == commonParams.Windows && offloaded:
+		return "windows-startup-script-url"
+	case runnerSpec.BootstrapParams.OSType == commonParams.Windows:
+		return "windows-startup-script-ps1"
+	case offloaded:
+		return "startup-script-url"
+	default:
+		return "startup-script"
+	}
+}
+
+// shouldOffloadUserData reports whether the rendered user-data should be
+// uploaded to GCS rather than embedded inline in instance metadata.
+// Ignition documents are excluded even when UserDataBucket is configured:
+// afterburn/Ignition has no URL-indirection convention for the "user-data"
+// metadata key, it reads that key's content directly as the Ignition
+// config, so offloading it there would hand the instance a bare gs:// or
+// HTTPS URL instead of a parseable config.
+func shouldOffloadUserData(runnerSpec *spec.RunnerSpec) bool {
+	return runnerSpec.UserDataBucket != "" && runnerSpec.UserDataFormat != spec.UserDataFormatIgnition
+}
+
+// composeUserDataMetadata renders the runner's user-data and returns the
+// metadata key/value pair it should be attached to the instance under. If
+// shouldOffloadUserData returns false, the rendered document is returned
+// inline, as before. Otherwise it is uploaded to GCS first, and a
+// reference to it (a gs:// URL, or a signed HTTPS URL when the runner's
+// service account differs from the provider's own) is returned instead, so
+// that user-data too large for instance metadata can still be delivered.
+func composeUserDataMetadata(ctx context.Context, cli *client.GcpCli, runnerSpec *spec.RunnerSpec) (string, string, error) {
+	userData, err := runnerSpec.ComposeUserData()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to compose user data: %w", err)
+	}
+
+	if !shouldOffloadUserData(runnerSpec) {
+		return userDataMetadataKey(runnerSpec, false), userData, nil
+	}
+
+	objectName := runnerSpec.UserDataObjectName()
+	bucket := cli.Storage().Bucket(runnerSpec.UserDataBucket)
+	object := bucket.Object(objectName)
+
+	w := object.NewWriter(ctx)
+	if _, err := w.Write([]byte(userData)); err != nil {
+		return "", "", fmt.Errorf("failed to upload user data to gs://%s/%s: %w", runnerSpec.UserDataBucket, objectName, err)
+	}
+	if err := w.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to upload user data to gs://%s/%s: %w", runnerSpec.UserDataBucket, objectName, err)
+	}
+
+	providerJWTConfig, err := readProviderJWTConfig(cli)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine provider service account: %w", err)
+	}
+
+	var runnerEmail string
+	if runnerSpec.ServiceAccount != nil {
+		runnerEmail = runnerSpec.ServiceAccount.Email
+	}
+
+	if runnerEmail != providerJWTConfig.Email {
+		url, err := signUserDataURL(providerJWTConfig, runnerSpec.UserDataBucket, objectName)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to sign url for gs://%s/%s: %w", runnerSpec.UserDataBucket, objectName, err)
+		}
+		return userDataMetadataKey(runnerSpec, true), url, nil
+	}
+
+	return userDataMetadataKey(runnerSpec, true), fmt.Sprintf("gs://%s/%s", runnerSpec.UserDataBucket, objectName), nil
+}
+
+// readProviderJWTConfig reads and parses the provider's own service account
+// credentials file, so callers can compare its account email against a
+// runner's, or sign GCS URLs with it.
+func readProviderJWTConfig(cli *client.GcpCli) (*jwt.Config, error) {
+	jsonKey, err := os.ReadFile(cli.CredentialsFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	jwtConfig, err := google.JWTConfigFromJSON(jsonKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+	return jwtConfig, nil
+}
+
+// signUserDataURL signs a short-lived HTTPS URL for the given bucket/object
+// using the provider's own service account credentials. A signed URL is
+// used, instead of a plain gs:// reference, whenever the runner's own
+// service account differs from the provider's: the runner's account may
+// not have been granted read access to the bucket.
+func signUserDataURL(providerJWTConfig *jwt.Config, bucketName, objectName string) (string, error) {
+	return storage.SignedURL(bucketName, objectName, &storage.SignedURLOptions{
+		GoogleAccessID: providerJWTConfig.Email,
+		PrivateKey:     providerJWTConfig.PrivateKey,
+		Method:         "GET",
+		Expires:        time.Now().Add(signedURLTTL),
+	})
+}
+
+// deleteUserDataObject best-effort deletes the GCS object a runner's
+// user-data was uploaded to, if any. Deletion failures here are not fatal:
+// they leave behind a stale object, not a stale instance, and the
+// bucket's lifecycle rule is expected to reap it eventually.
+func deleteUserDataObject(ctx context.Context, cli *client.GcpCli, objectName string) error {
+	if cli.UserDataBucket() == "" || objectName == "" {
+		return nil
+	}
+
+	if err := cli.Storage().Bucket(cli.UserDataBucket()).Object(objectName).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete gs://%s/%s: %w", cli.UserDataBucket(), objectName, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	commonParams "github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-gcp/internal/spec"
+)
+
+func TestUserDataMetadataKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		runnerSpec spec.RunnerSpec
+		offloaded  bool
+		want       string
+	}{
+		{
+			name:       "linux inline",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Linux}},
+			want:       "startup-script",
+		},
+		{
+			name:       "linux offloaded",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Linux}},
+			offloaded:  true,
+			want:       "startup-script-url",
+		},
+		{
+			name:       "windows inline",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Windows}},
+			want:       "windows-startup-script-ps1",
+		},
+		{
+			name:       "windows offloaded",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Windows}},
+			offloaded:  true,
+			want:       "windows-startup-script-url",
+		},
+		{
+			name:       "ignition inline",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Linux}, UserDataFormat: spec.UserDataFormatIgnition},
+			want:       "user-data",
+		},
+		{
+			name:       "ignition offloaded still uses user-data",
+			runnerSpec: spec.RunnerSpec{BootstrapParams: commonParams.BootstrapInstance{OSType: commonParams.Linux}, UserDataFormat: spec.UserDataFormatIgnition},
+			offloaded:  true,
+			want:       "user-data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userDataMetadataKey(&tt.runnerSpec, tt.offloaded)
+			if got != tt.want {
+				t.Fatalf("userDataMetadataKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldOffloadUserData(t *testing.T) {
+	tests := []struct {
+		name       string
+		runnerSpec spec.RunnerSpec
+		want       bool
+	}{
+		{
+			name:       "no bucket configured",
+			runnerSpec: spec.RunnerSpec{},
+			want:       false,
+		},
+		{
+			name:       "bucket configured, shell script format",
+			runnerSpec: spec.RunnerSpec{UserDataBucket: "runner-userdata"},
+			want:       true,
+		},
+		{
+			name:       "bucket configured, ignition format never offloads",
+			runnerSpec: spec.RunnerSpec{UserDataBucket: "runner-userdata", UserDataFormat: spec.UserDataFormatIgnition},
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldOffloadUserData(&tt.runnerSpec); got != tt.want {
+				t.Fatalf("shouldOffloadUserData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposeUserDataMetadataIgnitionWithBucketStaysInline(t *testing.T) {
+	runnerSpec := &spec.RunnerSpec{
+		UserDataBucket: "runner-userdata",
+		UserDataFormat: spec.UserDataFormatIgnition,
+		BootstrapParams: commonParams.BootstrapInstance{
+			OSType: commonParams.Linux,
+			Name:   "runner",
+		},
+	}
+
+	// A nil *client.GcpCli is fine here: shouldOffloadUserData must be
+	// false for this runnerSpec, so composeUserDataMetadata never reaches
+	// the code that would dereference cli.
+	key, value, err := composeUserDataMetadata(context.Background(), nil, runnerSpec)
+	if err != nil {
+		t.Fatalf("composeUserDataMetadata returned an error: %s", err)
+	}
+	if key != "user-data" {
+		t.Fatalf("expected the user-data metadata key, got %q", key)
+	}
+	if strings.HasPrefix(value, "gs://") || strings.HasPrefix(value, "https://") {
+		t.Fatalf("expected the raw ignition document, got what looks like a URL: %s", value)
+	}
+	if !strings.Contains(value, `"ignition"`) {
+		t.Fatalf("expected the raw ignition document, got: %s", value)
+	}
+}